@@ -2,13 +2,16 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"hash/fnv"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
@@ -16,53 +19,193 @@ import (
 
 const version = "0.1.0"
 
-const helpMessage = `Usage: count_locs <directory> <glob-patterns>...
+const helpMessage = `Usage: count_locs [options] <directory> <glob-patterns>...
 
 Options:
-  -h, --help       Show this help message
-  -v, --version    Show version information
+  -h, --help             Show this help message
+  --version              Show version information
+  -o, --output <mode>    Output format: text, json, ndjson (default "text")
+  --shard <n>            Index of this shard, 0-based (default 0)
+  --shards <n>           Total number of shards (default 1)
+  -x, --exclude <glob>   Glob pattern to exclude (repeatable)
+  --mode <mode>          Counting mode: nonempty, code, full (default "nonempty")
+  -n, --parallel <n>     Number of files to scan concurrently (default: number of CPUs)
+  -v, --verbose          Log each file and its line count as it completes
+  --summary              Print aggregate stats: files scanned/skipped, avg lines/file, p50/p95 file size
+
+A .countlocsignore file in <directory>, if present, is read in addition to
+any --exclude flags: one glob pattern per line, blank lines and lines
+starting with # are ignored.
+
+Counting modes:
+  nonempty   Total counts every non-blank line (code and comments)
+  code       Total counts only lines of code, excluding comments
+  full       Total counts every line, including blank lines
+Every mode reports the code/comment/blank breakdown; --mode only picks
+which figure is reported as the headline Total.
 
 Examples:
   count_locs ./src "**/*.rs" "**/*.ts"
   count_locs ./ "**/*.css"
+  count_locs --output json ./src "**/*.go" > locs.json
+  count_locs --shard 0 --shards 4 ./ "**/*.go"
+  count_locs -x "**/vendor/**" -x "**/*.min.js" ./ "**/*.js"
+  count_locs --mode code ./src "**/*.go"
+  count_locs -n 8 -v --summary ./ "**/*.go"
 `
 
+// stringSliceFlag accumulates the values of a repeatable flag, e.g.
+// -x foo -x bar yields []string{"foo", "bar"}.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// options bundles the settings parsed from the command line that govern how
+// processInput and countLocs behave.
+type options struct {
+	OutputMode string
+	ShardIndex int
+	ShardCount int
+	Excludes   []string
+	Mode       string
+	Parallel   int
+	Verbose    bool
+	Summary    bool
+}
+
 func main() {
-	args := os.Args
+	fs := flag.NewFlagSet("count_locs", flag.ExitOnError)
+	fs.Usage = printHelp
 
-	// When no arguments are provided, show error
-	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: count_locs <directory> <glob-patterns>...")
+	var showVersion bool
+	fs.BoolVar(&showVersion, "version", false, "Show version information")
+
+	var outputMode string
+	fs.StringVar(&outputMode, "output", "text", "Output format: text, json, ndjson")
+	fs.StringVar(&outputMode, "o", "text", "Output format (shorthand)")
+
+	var shardIndex, shardCount int
+	fs.IntVar(&shardIndex, "shard", 0, "Index of this shard, 0-based")
+	fs.IntVar(&shardCount, "shards", 1, "Total number of shards")
+
+	var excludes stringSliceFlag
+	fs.Var(&excludes, "exclude", "Glob pattern to exclude (repeatable)")
+	fs.Var(&excludes, "x", "Exclude pattern (shorthand, repeatable)")
+
+	var mode string
+	fs.StringVar(&mode, "mode", "nonempty", "Counting mode: nonempty, code, full")
+
+	var parallel int
+	fs.IntVar(&parallel, "parallel", 0, "Number of files to scan concurrently (default: number of CPUs)")
+	fs.IntVar(&parallel, "n", 0, "Parallelism (shorthand)")
+
+	var verbose bool
+	fs.BoolVar(&verbose, "verbose", false, "Log each file and its line count as it completes")
+	fs.BoolVar(&verbose, "v", false, "Verbose (shorthand)")
+
+	var summary bool
+	fs.BoolVar(&summary, "summary", false, "Print aggregate stats")
+
+	fs.Parse(os.Args[1:])
+
+	if showVersion {
+		printVersion()
+		return
+	}
+
+	switch outputMode {
+	case "text", "json", "ndjson":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid --output mode %q: must be one of text, json, ndjson\n", outputMode)
 		os.Exit(1)
 	}
 
-	// Handle help and version flags.
-	// Note: In Go, os.Args[0] is the program name.
-	if len(args) == 2 {
-		switch args[1] {
-		case "-h", "--help":
-			printHelp()
-			return
-		case "-v", "--version":
-			printVersion()
-			return
-		}
-		// If only one argument is given (and not help/version),
-		// show usage error.
-		fmt.Fprintln(os.Stderr, "Usage: count_locs <directory> <glob-patterns>...")
+	switch mode {
+	case "nonempty", "code", "full":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid --mode %q: must be one of nonempty, code, full\n", mode)
 		os.Exit(1)
 	}
 
-	// Otherwise the first argument is the directory and the remaining arguments are glob patterns.
-	dir := args[1]
-	patterns := args[2:]
+	if shardCount < 1 {
+		fmt.Fprintf(os.Stderr, "Invalid --shards %d: must be at least 1\n", shardCount)
+		os.Exit(1)
+	}
+	if shardIndex < 0 || shardIndex >= shardCount {
+		fmt.Fprintf(os.Stderr, "Invalid --shard %d: must be in [0, %d)\n", shardIndex, shardCount)
+		os.Exit(1)
+	}
+
+	if parallel < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid --parallel %d: must be at least 0\n", parallel)
+		os.Exit(1)
+	}
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// The first positional argument is the directory and the rest are glob patterns.
+	dir := args[0]
+	patterns := args[1:]
+
+	processInput(dir, patterns, options{
+		OutputMode: outputMode,
+		ShardIndex: shardIndex,
+		ShardCount: shardCount,
+		Excludes:   excludes,
+		Mode:       mode,
+		Parallel:   parallel,
+		Verbose:    verbose,
+		Summary:    summary,
+	})
+}
+
+// fileResult holds the code/comment/blank breakdown for a single matched file.
+// Total depends on the counting mode: it is Code for "code", Code+Comment+Blank
+// for "full", and Code+Comment (the pre-existing behavior) for "nonempty".
+type fileResult struct {
+	Path    string `json:"path"`
+	Code    int    `json:"code"`
+	Comment int    `json:"comment"`
+	Blank   int    `json:"blank"`
+	Total   int    `json:"total"`
+}
+
+// patternResult holds the aggregate and per-file breakdown for a single glob pattern.
+type patternResult struct {
+	Pattern string       `json:"pattern"`
+	Code    int          `json:"code"`
+	Comment int          `json:"comment"`
+	Blank   int          `json:"blank"`
+	Total   int          `json:"total"`
+	Files   []fileResult `json:"files,omitempty"`
+}
 
-	processInput(dir, patterns)
+// jsonReport is the top-level shape printed in --output json mode.
+type jsonReport struct {
+	Root       string          `json:"root"`
+	ElapsedNS  int64           `json:"elapsed_ns"`
+	Patterns   []patternResult `json:"patterns"`
+	Total      int             `json:"total"`
+	ShardIndex int             `json:"shard_index"`
+	ShardCount int             `json:"shard_count"`
+	FileCount  int             `json:"file_count"`
 }
 
 // processInput performs the work: it canonicalizes the directory,
-// counts lines for each glob pattern concurrently, and prints the result.
-func processInput(dir string, patterns []string) {
+// counts lines for each glob pattern concurrently, and prints the result
+// according to opts.
+func processInput(dir string, patterns []string, opts options) {
 	startTime := time.Now()
 
 	absDir, err := filepath.Abs(dir)
@@ -71,94 +214,512 @@ func processInput(dir string, patterns []string) {
 		os.Exit(1)
 	}
 
-	results := countLocs(absDir, patterns)
+	opts.Excludes = append(opts.Excludes, loadIgnoreFile(absDir)...)
+
+	var enc *json.Encoder
+	var onFile func(pattern string, f fileResult)
+	if opts.OutputMode == "ndjson" {
+		enc = json.NewEncoder(os.Stdout)
+		onFile = func(pattern string, f fileResult) {
+			enc.Encode(struct {
+				Pattern string `json:"pattern"`
+				fileResult
+			}{pattern, f})
+		}
+	}
+
+	results, stats := countLocs(absDir, patterns, opts, onFile)
 
-	// Sum the total lines across all patterns.
 	totalLines := 0
-	for _, count := range results {
-		totalLines += count
+	fileCount := 0
+	var totalCode, totalComment, totalBlank int
+	for _, result := range results {
+		totalLines += result.Total
+		totalCode += result.Code
+		totalComment += result.Comment
+		totalBlank += result.Blank
+		fileCount += len(result.Files)
 	}
 
-	// If more than one pattern, show the breakdown.
-	if len(patterns) > 1 {
-		fmt.Println("Breakdown of Lines of Code by Glob:")
-		fmt.Println()
+	elapsed := time.Since(startTime)
+
+	switch opts.OutputMode {
+	case "json":
+		report := jsonReport{
+			Root:       absDir,
+			ElapsedNS:  elapsed.Nanoseconds(),
+			Patterns:   results,
+			Total:      totalLines,
+			ShardIndex: opts.ShardIndex,
+			ShardCount: opts.ShardCount,
+			FileCount:  fileCount,
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode JSON output: %v\n", err)
+			os.Exit(1)
+		}
+	case "ndjson":
+		enc.Encode(map[string]interface{}{
+			"type":        "summary",
+			"root":        absDir,
+			"elapsed_ns":  elapsed.Nanoseconds(),
+			"total":       totalLines,
+			"shard_index": opts.ShardIndex,
+			"shard_count": opts.ShardCount,
+			"file_count":  fileCount,
+		})
+	default:
+		// If more than one pattern, show the breakdown.
+		if len(patterns) > 1 {
+			fmt.Println("Breakdown of Lines of Code by Glob:")
+			fmt.Println()
+			fmt.Printf("%-24s %8s %8s %8s %8s\n", "Pattern", "Code", "Comment", "Blank", "Total")
+			for _, result := range results {
+				fmt.Printf("%-24s %8d %8d %8d %8d\n", result.Pattern, result.Code, result.Comment, result.Blank, result.Total)
+			}
+
+			fmt.Println()
+		}
+
+		if opts.ShardCount > 1 {
+			fmt.Printf("Shard:\t%d/%d (%d files)\n", opts.ShardIndex, opts.ShardCount, fileCount)
+		}
+
+		fmt.Printf("Total:\t%d lines of code (code: %d, comment: %d, blank: %d)\n\nElapsed time: %v\n",
+			totalLines, totalCode, totalComment, totalBlank, elapsed)
 
-		for pattern, count := range results {
-			fmt.Printf("-  %s: %d\n", pattern, count)
+		if opts.Summary {
+			printSummary(stats, totalLines)
 		}
+	}
+}
 
-		fmt.Println()
+// printSummary prints the aggregate stats requested by --summary: how many
+// files were scanned vs. skipped (by sharding, exclusion, a stat error, or
+// because the match is a directory),
+// the average lines per scanned file, and the p50/p95 file size.
+func printSummary(stats scanStats, totalLines int) {
+	avgLines := 0.0
+	if stats.FilesScanned > 0 {
+		avgLines = float64(totalLines) / float64(stats.FilesScanned)
 	}
 
-	elapsed := time.Since(startTime)
-	fmt.Printf("Total:\t%d lines of code\n\nElapsed time: %v\n", totalLines, elapsed)
+	sizes := append([]int64(nil), stats.FileSizes...)
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Printf("  Files scanned:    %d\n", stats.FilesScanned)
+	fmt.Printf("  Files skipped:    %d\n", stats.FilesSkipped)
+	fmt.Printf("  Avg lines/file:   %.1f\n", avgLines)
+	fmt.Printf("  p50 file size:    %d bytes\n", percentile(sizes, 0.5))
+	fmt.Printf("  p95 file size:    %d bytes\n", percentile(sizes, 0.95))
+}
+
+// percentile returns the value at the given percentile (0..1) of a sorted
+// slice, or 0 if it's empty.
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p * float64(len(sorted)-1))
+	if idx < 0 {
+		idx = 0
+	} else if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// scanJob is one unit of work for the countLocs worker pool: count a single
+// file that matched patternIdx's glob.
+type scanJob struct {
+	patternIdx int
+	pattern    string
+	relPath    string
+	fullPath   string
+	size       int64
+}
+
+// scanStats carries the aggregate bookkeeping --summary reports, alongside
+// the per-pattern results.
+type scanStats struct {
+	FilesScanned int
+	FilesSkipped int
+	FileSizes    []int64
 }
 
 // countLocs processes each glob pattern under the given root directory.
-// It uses the doublestar.Glob function to support recursive globbing.
-// For each matching file, it counts the non-empty (and non-whitespace) lines concurrently.
-func countLocs(root string, patterns []string) map[string]int {
-	results := make(map[string]int)
+// It uses the doublestar.Glob function to support recursive globbing, then
+// classifies every matched file's lines as code, comment, or blank using a
+// fixed pool of opts.Parallel workers (or runtime.NumCPU() if unset) reading
+// from a shared job channel. A fixed pool scales far better than spawning one
+// goroutine per file once a tree has hundreds of thousands of matches. If
+// onFile is non-nil, it is called once per file as soon as that file's counts
+// are ready, which lets callers stream results (e.g. ndjson output) instead
+// of waiting for every pattern to finish. When opts.ShardCount is greater
+// than 1, only files whose relative path hashes into opts.ShardIndex are
+// processed, so that N independent invocations (one per shard) partition the
+// work deterministically.
+func countLocs(root string, patterns []string, opts options, onFile func(pattern string, f fileResult)) ([]patternResult, scanStats) {
+	fsys := os.DirFS(root)
 
-	for _, pattern := range patterns {
-		// Create a filesystem rooted at 'root'
-		fsys := os.DirFS(root)
+	var jobs []scanJob
+	var stats scanStats
+	validPattern := make([]bool, len(patterns))
 
-		// Use doublestar.Glob with the fs.FS argument and the pattern.
+	for i, pattern := range patterns {
 		matches, err := doublestar.Glob(fsys, pattern)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error processing pattern %s: %v\n", pattern, err)
 			continue
 		}
+		validPattern[i] = true
 
-		var total int64
-		var wg sync.WaitGroup
-		sem := make(chan struct{}, runtime.NumCPU())
-
-		// Process each matching file concurrently.
 		for _, file := range matches {
+			if opts.ShardCount > 1 && !inShard(file, opts.ShardIndex, opts.ShardCount) {
+				stats.FilesSkipped++
+				continue
+			}
+			if isExcluded(file, opts.Excludes) {
+				stats.FilesSkipped++
+				continue
+			}
+
 			// Since the file paths are relative to the filesystem root, build the absolute path.
 			fullPath := filepath.Join(root, file)
 			info, err := os.Stat(fullPath)
 			if err != nil || info.IsDir() {
+				stats.FilesSkipped++
 				continue
 			}
 
-			wg.Add(1)
-			go func(filePath string) {
-				defer wg.Done()
-				sem <- struct{}{}
-				count := countLines(filePath)
-				atomic.AddInt64(&total, int64(count))
-				<-sem
-			}(fullPath)
+			jobs = append(jobs, scanJob{patternIdx: i, pattern: pattern, relPath: file, fullPath: fullPath, size: info.Size()})
 		}
-		wg.Wait()
-		results[pattern] = int(total)
 	}
 
-	return results
+	stats.FilesScanned = len(jobs)
+	stats.FileSizes = make([]int64, len(jobs))
+	for i, j := range jobs {
+		stats.FileSizes[i] = j.size
+	}
+
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = runtime.NumCPU()
+	}
+
+	jobCh := make(chan scanJob)
+	filesByPattern := make([][]fileResult, len(patterns))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				code, comment, blank := countLinesDetailed(job.fullPath)
+				result := fileResult{
+					Path:    job.relPath,
+					Code:    code,
+					Comment: comment,
+					Blank:   blank,
+					Total:   modeTotal(opts.Mode, code, comment, blank),
+				}
+
+				mu.Lock()
+				filesByPattern[job.patternIdx] = append(filesByPattern[job.patternIdx], result)
+				mu.Unlock()
+
+				if opts.Verbose {
+					fmt.Fprintf(os.Stderr, "%s: %d lines\n", job.relPath, result.Total)
+				}
+				if onFile != nil {
+					onFile(job.pattern, result)
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		jobCh <- job
+	}
+	close(jobCh)
+	wg.Wait()
+
+	results := make([]patternResult, 0, len(patterns))
+	for i, pattern := range patterns {
+		if !validPattern[i] {
+			continue
+		}
+		files := filesByPattern[i]
+
+		var result patternResult
+		result.Pattern = pattern
+		for _, f := range files {
+			result.Code += f.Code
+			result.Comment += f.Comment
+			result.Blank += f.Blank
+			result.Total += f.Total
+		}
+		result.Files = files
+		results = append(results, result)
+	}
+
+	return results, stats
+}
+
+// modeTotal picks the headline Total figure for the given counting mode:
+// "code" counts only code lines, "full" counts every line including blanks,
+// and "nonempty" (the default, and the tool's original behavior) counts every
+// non-blank line, i.e. code and comments together.
+func modeTotal(mode string, code, comment, blank int) int {
+	switch mode {
+	case "code":
+		return code
+	case "full":
+		return code + comment + blank
+	default: // "nonempty"
+		return code + comment
+	}
+}
+
+// inShard reports whether relPath belongs to the given shard out of shardCount
+// total shards, based on the fnv-1a hash of its path. The hash is stable
+// across runs and machines, so parallel shard invocations partition the same
+// file set deterministically without needing to coordinate.
+func inShard(relPath string, shardIndex, shardCount int) bool {
+	h := fnv.New64a()
+	h.Write([]byte(relPath))
+	return int(h.Sum64()%uint64(shardCount)) == shardIndex
+}
+
+// ignoreFileName is the gitignore-style exclusion file read from the root
+// directory passed to processInput, in addition to any --exclude flags.
+const ignoreFileName = ".countlocsignore"
+
+// loadIgnoreFile reads ignoreFileName from root and returns its patterns,
+// skipping blank lines and '#' comments. A missing file is not an error.
+func loadIgnoreFile(root string) []string {
+	data, err := os.ReadFile(filepath.Join(root, ignoreFileName))
+	if err != nil {
+		return nil
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// isExcluded reports whether relPath matches any of the exclusion patterns.
+// Patterns are matched with doublestar.Match, and a pattern with no slash
+// (e.g. "node_modules") also matches that name as a path segment anywhere in
+// the tree, mirroring the common gitignore shorthand.
+func isExcluded(relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+
+		candidates := []string{pattern, pattern + "/**"}
+		if !strings.Contains(pattern, "/") {
+			candidates = append(candidates, "**/"+pattern, "**/"+pattern+"/**")
+		}
+
+		for _, candidate := range candidates {
+			if ok, err := doublestar.Match(candidate, relPath); err == nil && ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commentDelim is a paired block-comment delimiter, e.g. "/*" and "*/".
+type commentDelim struct {
+	Start string
+	End   string
+}
+
+// languageRules describes how to recognize comments and string literals for
+// a file extension, so that a line-comment marker inside a string (e.g. the
+// "//" in a URL) is not mistaken for the start of a comment.
+type languageRules struct {
+	LineComments  []string
+	BlockComments []commentDelim
+	Strings       []string
+}
+
+// languageRegistry maps lowercased file extensions to their comment/string
+// rules. Extensions with no entry are treated as having no comment syntax, so
+// every non-blank line is counted as code.
+var languageRegistry = map[string]languageRules{
+	".go":   {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "`"}},
+	".c":    {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'"}},
+	".h":    {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'"}},
+	".cpp":  {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'"}},
+	".hpp":  {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'"}},
+	".java": {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'"}},
+	".rs":   {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`}},
+	".js":   {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'", "`"}},
+	".jsx":  {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'", "`"}},
+	".ts":   {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'", "`"}},
+	".tsx":  {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'", "`"}},
+	".css":  {BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'"}},
+	".scss": {LineComments: []string{"//"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{`"`, "'"}},
+	".py":   {LineComments: []string{"#"}, BlockComments: []commentDelim{{`"""`, `"""`}, {"'''", "'''"}}, Strings: []string{`"`, "'"}},
+	".rb":   {LineComments: []string{"#"}, BlockComments: []commentDelim{{"=begin", "=end"}}, Strings: []string{`"`, "'"}},
+	".sh":   {LineComments: []string{"#"}, Strings: []string{`"`, "'"}},
+	".sql":  {LineComments: []string{"--"}, BlockComments: []commentDelim{{"/*", "*/"}}, Strings: []string{"'"}},
+	".lua":  {LineComments: []string{"--"}, BlockComments: []commentDelim{{"--[[", "]]"}}, Strings: []string{`"`, "'"}},
+	".html": {BlockComments: []commentDelim{{"<!--", "-->"}}, Strings: []string{`"`, "'"}},
+	".xml":  {BlockComments: []commentDelim{{"<!--", "-->"}}, Strings: []string{`"`, "'"}},
+}
+
+// rulesForFile looks up the languageRules for filePath's extension, or the
+// zero value (no comment syntax recognized) if the extension is unregistered.
+func rulesForFile(filePath string) languageRules {
+	return languageRegistry[strings.ToLower(filepath.Ext(filePath))]
+}
+
+// scanState tracks whether a block comment opened on an earlier line is still
+// open, so classification can carry that state from one line to the next.
+type scanState struct {
+	inBlockComment bool
+	blockEnd       string
+}
+
+// classifyLine reports whether line is blank or a comment line, given rules
+// and the running scanState (updated in place). A line with any code content
+// outside of strings, line comments, and block comments is neither.
+func classifyLine(line string, rules languageRules, state *scanState) (isBlank, isComment bool) {
+	hasCode := false
+	hasComment := false
+
+	i := 0
+	for i < len(line) {
+		if state.inBlockComment {
+			hasComment = true
+			idx := strings.Index(line[i:], state.blockEnd)
+			if idx == -1 {
+				break
+			}
+			i += idx + len(state.blockEnd)
+			state.inBlockComment = false
+			continue
+		}
+
+		// Block-comment starts are checked before string delimiters: a
+		// string quote (e.g. `"`) can be a strict prefix of a block
+		// delimiter (e.g. `"""`), so matching strings first would keep
+		// the longer, more specific delimiter from ever firing.
+		if b, ok := matchBlockStart(line[i:], rules.BlockComments); ok {
+			hasComment = true
+			closeIdx := strings.Index(line[i+len(b.Start):], b.End)
+			if closeIdx == -1 {
+				state.inBlockComment = true
+				state.blockEnd = b.End
+				break
+			}
+			i += len(b.Start) + closeIdx + len(b.End)
+			continue
+		}
+
+		if q, ok := matchAny(line[i:], rules.Strings); ok {
+			hasCode = true
+			end := findStringEnd(line, i+len(q), q)
+			if end == -1 {
+				break
+			}
+			i = end + len(q)
+			continue
+		}
+
+		if _, ok := matchAny(line[i:], rules.LineComments); ok {
+			hasComment = true
+			break
+		}
+
+		if c := line[i]; c != ' ' && c != '\t' {
+			hasCode = true
+		}
+		i++
+	}
+
+	if hasCode {
+		return false, false
+	}
+	return !hasComment, hasComment
+}
+
+// matchAny reports whether s starts with any of candidates, returning the one matched.
+func matchAny(s string, candidates []string) (string, bool) {
+	for _, c := range candidates {
+		if strings.HasPrefix(s, c) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// matchBlockStart reports whether s starts with the opening delimiter of any
+// of blocks, returning the delimiter pair matched.
+func matchBlockStart(s string, blocks []commentDelim) (commentDelim, bool) {
+	for _, b := range blocks {
+		if strings.HasPrefix(s, b.Start) {
+			return b, true
+		}
+	}
+	return commentDelim{}, false
+}
+
+// findStringEnd returns the index in line of the closing quote matching
+// quote, starting the search at start and honoring backslash escapes, or -1
+// if the string is left unterminated on this line.
+func findStringEnd(line string, start int, quote string) int {
+	for i := start; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(line[i:], quote) {
+			return i
+		}
+	}
+	return -1
 }
 
-// countLines opens the file at filePath and counts the number of non-empty, non-whitespace lines.
-func countLines(filePath string) int {
+// countLinesDetailed opens the file at filePath and classifies every line as
+// code, comment, or blank, using the language rules registered for its
+// extension. A file that cannot be opened counts as empty.
+func countLinesDetailed(filePath string) (code, comment, blank int) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		// If the file cannot be opened, count it as 0 lines.
-		return 0
+		return 0, 0, 0
 	}
 	defer file.Close()
 
+	rules := rulesForFile(filePath)
+	state := &scanState{}
+
 	scanner := bufio.NewScanner(file)
-	count := 0
 	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.TrimSpace(line) != "" {
-			count++
+		isBlank, isComment := classifyLine(scanner.Text(), rules, state)
+		switch {
+		case isBlank:
+			blank++
+		case isComment:
+			comment++
+		default:
+			code++
 		}
 	}
-	return count
+	return code, comment, blank
 }
 
 // printHelp displays the help message.
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -11,9 +12,11 @@ import (
 	"time"
 )
 
-// TestCountLines creates a temporary file with known content and
-// ensures that countLines returns the expected count of non-empty lines.
-func TestCountLines(t *testing.T) {
+// TestCountLinesDetailed creates a temporary file with known content and
+// ensures that countLinesDetailed classifies its lines correctly. The file
+// has a .txt extension, which has no registered comment syntax, so every
+// non-blank line is counted as code.
+func TestCountLinesDetailed(t *testing.T) {
 	// Prepare a temporary file with a mix of non-empty and whitespace lines.
 	content := "Line one\n\n   \nLine two\nLine three\n"
 	tmpFile, err := os.CreateTemp("", "testfile*.txt")
@@ -27,10 +30,56 @@ func TestCountLines(t *testing.T) {
 	}
 	tmpFile.Close()
 
-	// Expected: "Line one", "Line two", and "Line three" (3 lines).
-	count := countLines(tmpFile.Name())
-	if count != 3 {
-		t.Errorf("expected 3 non-empty lines, got %d", count)
+	// Expected: "Line one", "Line two", and "Line three" as code, 2 blank lines.
+	code, comment, blank := countLinesDetailed(tmpFile.Name())
+	if code != 3 || comment != 0 || blank != 2 {
+		t.Errorf("expected code=3 comment=0 blank=2, got code=%d comment=%d blank=%d", code, comment, blank)
+	}
+}
+
+// TestClassifyLineIgnoresCommentMarkersInStrings verifies that a "//" inside
+// a string literal is not misclassified as the start of a line comment.
+func TestClassifyLineIgnoresCommentMarkersInStrings(t *testing.T) {
+	rules := languageRegistry[".go"]
+	state := &scanState{}
+
+	isBlank, isComment := classifyLine(`url := "http://example.com"`, rules, state)
+	if isBlank || isComment {
+		t.Errorf("expected a code line, got blank=%v comment=%v", isBlank, isComment)
+	}
+
+	isBlank, isComment = classifyLine(`// http://example.com`, rules, state)
+	if isBlank || !isComment {
+		t.Errorf("expected a comment line, got blank=%v comment=%v", isBlank, isComment)
+	}
+}
+
+// TestClassifyLinePythonDocstring verifies that a triple-quoted Python
+// docstring is classified as a block comment rather than as code, even
+// though `"` is a prefix of `"""` and would otherwise match as a string
+// delimiter first.
+func TestClassifyLinePythonDocstring(t *testing.T) {
+	rules := languageRegistry[".py"]
+	state := &scanState{}
+
+	isBlank, isComment := classifyLine(`"""`, rules, state)
+	if isBlank || !isComment {
+		t.Errorf("expected docstring open line to be a comment, got blank=%v comment=%v", isBlank, isComment)
+	}
+
+	isBlank, isComment = classifyLine(`This is a docstring.`, rules, state)
+	if isBlank || !isComment {
+		t.Errorf("expected docstring body line to be a comment, got blank=%v comment=%v", isBlank, isComment)
+	}
+
+	isBlank, isComment = classifyLine(`"""`, rules, state)
+	if isBlank || !isComment {
+		t.Errorf("expected docstring close line to be a comment, got blank=%v comment=%v", isBlank, isComment)
+	}
+
+	isBlank, isComment = classifyLine(`x = 1`, rules, state)
+	if isBlank || isComment {
+		t.Errorf("expected code after docstring, got blank=%v comment=%v", isBlank, isComment)
 	}
 }
 
@@ -69,14 +118,24 @@ func TestCountLocs(t *testing.T) {
 	}
 
 	patterns := []string{"**/*.txt"}
-	results := countLocs(tempDir, patterns)
-	total := results["**/*.txt"]
+	results, _ := countLocs(tempDir, patterns, options{}, nil)
+	total := totalFor(results, "**/*.txt")
 	expectedTotal := 2 + 3
 	if total != expectedTotal {
 		t.Errorf("expected %d lines total, got %d", expectedTotal, total)
 	}
 }
 
+// totalFor looks up the total line count for a pattern in a countLocs result.
+func totalFor(results []patternResult, pattern string) int {
+	for _, r := range results {
+		if r.Pattern == pattern {
+			return r.Total
+		}
+	}
+	return 0
+}
+
 // TestProcessInputMultiplePatterns creates a temporary directory with two files
 // matching different glob patterns and then calls processInput.
 // It captures standard output and verifies that the printed breakdown and totals are present.
@@ -114,7 +173,7 @@ func TestProcessInputMultiplePatterns(t *testing.T) {
 
 	// Call processInput. (Note that processInput prints elapsed time so we allow a little slack.)
 	start := time.Now()
-	processInput(tempDir, patterns)
+	processInput(tempDir, patterns, options{OutputMode: "text"})
 	elapsed := time.Since(start)
 	_ = elapsed // Not asserting on elapsed time; just illustrating that it is printed.
 
@@ -132,14 +191,66 @@ func TestProcessInputMultiplePatterns(t *testing.T) {
 	if !strings.Contains(output, "Breakdown of Lines of Code by Glob:") {
 		t.Errorf("expected breakdown header in output, got: %s", output)
 	}
-	if !strings.Contains(output, "**/*.rs:") || !strings.Contains(output, "**/*.ts:") {
+	if !strings.Contains(output, "**/*.rs") || !strings.Contains(output, "**/*.ts") {
 		t.Errorf("expected glob patterns to be listed in output, got: %s", output)
 	}
+	if !strings.Contains(output, "Code") || !strings.Contains(output, "Comment") || !strings.Contains(output, "Blank") {
+		t.Errorf("expected a code/comment/blank breakdown header in output, got: %s", output)
+	}
 	if !strings.Contains(output, "Total:") {
 		t.Errorf("expected total line count in output, got: %s", output)
 	}
 }
 
+// TestProcessInputJSONOutput verifies that --output json produces a single
+// JSON document matching the documented schema.
+func TestProcessInputJSONOutput(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testjson")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	filePath := filepath.Join(tempDir, "file1.txt")
+	if err := os.WriteFile(filePath, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("failed to write file1.txt: %v", err)
+	}
+
+	patterns := []string{"**/*.txt"}
+
+	oldStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+
+	processInput(tempDir, patterns, options{OutputMode: "json"})
+
+	w.Close()
+	os.Stdout = oldStdout
+	var outputBuilder strings.Builder
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		outputBuilder.WriteString(scanner.Text())
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal([]byte(outputBuilder.String()), &report); err != nil {
+		t.Fatalf("failed to unmarshal JSON output: %v, got: %s", err, outputBuilder.String())
+	}
+
+	if report.Total != 2 {
+		t.Errorf("expected total 2, got %d", report.Total)
+	}
+	if len(report.Patterns) != 1 || report.Patterns[0].Pattern != "**/*.txt" {
+		t.Errorf("expected one pattern result for **/*.txt, got: %+v", report.Patterns)
+	}
+	if len(report.Patterns[0].Files) != 1 || report.Patterns[0].Files[0].Total != 2 {
+		t.Errorf("expected one file with 2 lines, got: %+v", report.Patterns[0].Files)
+	}
+}
+
 // TestPrintHelp captures the output of printHelp and verifies it contains expected help text.
 func TestPrintHelp(t *testing.T) {
 	// Redirect stdout.
@@ -217,8 +328,189 @@ func TestCountLocsConcurrency(t *testing.T) {
 	}
 
 	patterns := []string{"**/*.txt"}
-	results := countLocs(tempDir, patterns)
-	if results["**/*.txt"] != totalExpected {
-		t.Errorf("expected %d lines total, got %d", totalExpected, results["**/*.txt"])
+	results, _ := countLocs(tempDir, patterns, options{}, nil)
+	if total := totalFor(results, "**/*.txt"); total != totalExpected {
+		t.Errorf("expected %d lines total, got %d", totalExpected, total)
+	}
+}
+
+// TestCountLocsSharding verifies that splitting a directory across shards
+// partitions every file exactly once and that the shards' totals sum back
+// to the unsharded total.
+func TestCountLocsSharding(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testshard")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	numFiles := 20
+	for i := 0; i < numFiles; i++ {
+		filePath := filepath.Join(tempDir, "file_"+strconv.Itoa(i)+".txt")
+		if err := os.WriteFile(filePath, []byte("Line 1\nLine 2\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", filePath, err)
+		}
+	}
+
+	patterns := []string{"**/*.txt"}
+	const shardCount = 4
+
+	wholeResults, _ := countLocs(tempDir, patterns, options{}, nil)
+	wantTotal := totalFor(wholeResults, "**/*.txt")
+	wantFiles := len(wholeResults[0].Files)
+
+	seenFiles := make(map[string]bool)
+	gotTotal := 0
+	for shard := 0; shard < shardCount; shard++ {
+		shardResults, _ := countLocs(tempDir, patterns, options{ShardIndex: shard, ShardCount: shardCount}, nil)
+		for _, f := range shardResults[0].Files {
+			if seenFiles[f.Path] {
+				t.Errorf("file %s was counted by more than one shard", f.Path)
+			}
+			seenFiles[f.Path] = true
+		}
+		gotTotal += totalFor(shardResults, "**/*.txt")
+	}
+
+	if gotTotal != wantTotal {
+		t.Errorf("expected shards to sum to %d lines, got %d", wantTotal, gotTotal)
+	}
+	if len(seenFiles) != wantFiles {
+		t.Errorf("expected %d files to be covered across shards, got %d", wantFiles, len(seenFiles))
+	}
+}
+
+// TestCountLocsExcludes verifies that --exclude patterns drop matching files
+// from the totals.
+func TestCountLocsExcludes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testexclude")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	vendorDir := filepath.Join(tempDir, "vendor")
+	if err := os.Mkdir(vendorDir, 0755); err != nil {
+		t.Fatalf("failed to create vendor dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(vendorDir, "lib.txt"), []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatalf("failed to write vendor/lib.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "main.txt"), []byte("x\ny\n"), 0644); err != nil {
+		t.Fatalf("failed to write main.txt: %v", err)
+	}
+
+	patterns := []string{"**/*.txt"}
+	results, _ := countLocs(tempDir, patterns, options{Excludes: []string{"vendor"}}, nil)
+
+	if total := totalFor(results, "**/*.txt"); total != 2 {
+		t.Errorf("expected vendor/lib.txt to be excluded, got total %d", total)
+	}
+}
+
+// TestCountLocsModes verifies that --mode picks the right headline Total for
+// a file containing code, a comment, and a blank line.
+func TestCountLocsModes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testmode")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	content := "package main\n\n// a comment\nfunc main() {}\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "file1.go"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write file1.go: %v", err)
+	}
+
+	patterns := []string{"**/*.go"}
+
+	cases := []struct {
+		mode string
+		want int
+	}{
+		{"nonempty", 3}, // 2 code + 1 comment
+		{"code", 2},
+		{"full", 4}, // 2 code + 1 comment + 1 blank
+	}
+	for _, c := range cases {
+		results, _ := countLocs(tempDir, patterns, options{Mode: c.mode}, nil)
+		if total := totalFor(results, "**/*.go"); total != c.want {
+			t.Errorf("mode %q: expected total %d, got %d", c.mode, c.want, total)
+		}
+	}
+}
+
+// TestLoadIgnoreFile verifies that a .countlocsignore file is parsed into
+// patterns, skipping blank lines and comments.
+func TestLoadIgnoreFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testignorefile")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	content := "# comment\n\nvendor\nnode_modules\n"
+	if err := os.WriteFile(filepath.Join(tempDir, ".countlocsignore"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write .countlocsignore: %v", err)
+	}
+
+	patterns := loadIgnoreFile(tempDir)
+	want := []string{"vendor", "node_modules"}
+	if len(patterns) != len(want) {
+		t.Fatalf("expected %v, got %v", want, patterns)
+	}
+	for i, p := range want {
+		if patterns[i] != p {
+			t.Errorf("expected pattern %d to be %q, got %q", i, p, patterns[i])
+		}
+	}
+}
+
+// TestCountLocsParallelism verifies that countLocs produces the same totals
+// and scanStats regardless of the requested worker count, including the
+// default (Parallel == 0, meaning runtime.NumCPU()).
+func TestCountLocsParallelism(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "testparallel")
+	if err != nil {
+		t.Fatalf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	numFiles := 10
+	for i := 0; i < numFiles; i++ {
+		filePath := filepath.Join(tempDir, "file_"+strconv.Itoa(i)+".txt")
+		if err := os.WriteFile(filePath, []byte("Line 1\nLine 2\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", filePath, err)
+		}
+	}
+
+	patterns := []string{"**/*.txt"}
+
+	for _, parallel := range []int{0, 1, 3} {
+		results, stats := countLocs(tempDir, patterns, options{Parallel: parallel}, nil)
+		if total := totalFor(results, "**/*.txt"); total != numFiles*2 {
+			t.Errorf("parallel=%d: expected %d lines total, got %d", parallel, numFiles*2, total)
+		}
+		if stats.FilesScanned != numFiles {
+			t.Errorf("parallel=%d: expected %d files scanned, got %d", parallel, numFiles, stats.FilesScanned)
+		}
+		if len(stats.FileSizes) != numFiles {
+			t.Errorf("parallel=%d: expected %d file sizes recorded, got %d", parallel, numFiles, len(stats.FileSizes))
+		}
+	}
+}
+
+// TestPercentile verifies percentile lookups against a small sorted sample.
+func TestPercentile(t *testing.T) {
+	sorted := []int64{10, 20, 30, 40, 50}
+
+	if p := percentile(sorted, 0); p != 10 {
+		t.Errorf("expected p0 to be 10, got %d", p)
+	}
+	if p := percentile(sorted, 0.5); p != 30 {
+		t.Errorf("expected p50 to be 30, got %d", p)
+	}
+	if p := percentile(sorted, 1); p != 50 {
+		t.Errorf("expected p100 to be 50, got %d", p)
 	}
 }